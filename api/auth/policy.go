@@ -0,0 +1,63 @@
+package auth
+
+// Role names stored on models.User.Role. Kept as plain strings (rather than
+// an enum type) so they round-trip through GORM and JSON without custom
+// marshaling.
+const (
+	RoleGuest     = "guest"
+	RoleUser      = "user"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
+// Subject is the minimal user shape a Policy needs to decide. models.User
+// satisfies it without this package importing models, which would create an
+// import cycle (models imports auth for the role constants).
+type Subject interface {
+	GetID() uint32
+	GetRole() string
+}
+
+// Policy decides whether a subject may perform an action on a resource.
+type Policy struct {
+	// rules maps a role to the set of "action:resource" strings it's allowed.
+	// "*" matches any action or any resource.
+	rules map[string]map[string]bool
+}
+
+// NewDefaultPolicy returns the standard policy matrix: admins can do
+// anything; moderators can delete posts and comments; everyone else can
+// only act on resources they own, which Can checks against the ownerID the
+// caller passes.
+func NewDefaultPolicy() *Policy {
+	return &Policy{
+		rules: map[string]map[string]bool{
+			RoleAdmin: {
+				"*:*": true,
+			},
+			RoleModerator: {
+				"delete:post":    true,
+				"delete:comment": true,
+			},
+		},
+	}
+}
+
+// Can reports whether the subject may perform action on resource. For
+// actions not granted by role alone (e.g. a regular user editing their own
+// post), pass ownerID so Can can allow subjects acting on their own
+// resources.
+func (p *Policy) Can(subject Subject, action, resource string, ownerID uint32) bool {
+	if subject == nil {
+		return false
+	}
+
+	role := subject.GetRole()
+	if granted, ok := p.rules[role]; ok {
+		if granted["*:*"] || granted[action+":"+resource] || granted[action+":*"] || granted["*:"+resource] {
+			return true
+		}
+	}
+
+	return subject.GetID() != 0 && subject.GetID() == ownerID
+}
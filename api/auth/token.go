@@ -0,0 +1,60 @@
+package auth
+
+import (
+	"errors"
+	"os"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// accessTokenLifetime is how long an access JWT is valid before the client
+// must use its refresh token to get a new one.
+const accessTokenLifetime = 15 * time.Minute
+
+// Claims are the custom JWT claims embedded in every access token.
+// TokenVersion is compared against models.User.TokenVersion by middleware so
+// a "sign out everywhere" can invalidate every access token already issued.
+type Claims struct {
+	UserID       uint32 `json:"user_id"`
+	Role         string `json:"role"`
+	TokenVersion uint32 `json:"token_version"`
+	jwt.StandardClaims
+}
+
+func signingKey() []byte {
+	return []byte(os.Getenv("JWT_SECRET"))
+}
+
+// GenerateAccessToken issues a short-lived JWT for the given user identity.
+func GenerateAccessToken(userID uint32, role string, tokenVersion uint32) (string, error) {
+	claims := Claims{
+		UserID:       userID,
+		Role:         role,
+		TokenVersion: tokenVersion,
+		StandardClaims: jwt.StandardClaims{
+			ExpiresAt: time.Now().Add(accessTokenLifetime).Unix(),
+			IssuedAt:  time.Now().Unix(),
+		},
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString(signingKey())
+}
+
+// ParseAccessToken validates a JWT and returns its claims.
+func ParseAccessToken(tokenString string) (*Claims, error) {
+	claims := &Claims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(t *jwt.Token) (interface{}, error) {
+		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, errors.New("unexpected signing method")
+		}
+		return signingKey(), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !token.Valid {
+		return nil, errors.New("invalid token")
+	}
+	return claims, nil
+}
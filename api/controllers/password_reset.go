@@ -0,0 +1,77 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/jinzhu/gorm"
+	"github.com/yimikao/forum/api/mailer"
+	"github.com/yimikao/forum/api/models"
+)
+
+// ForgotPassword validates the supplied email, creates a reset token for the
+// matching user, and emails the reset link. A malformed body or email gets
+// 422; any well-formed email gets 200, even when it's unknown, so callers
+// can't enumerate accounts.
+func ForgotPassword(db *gorm.DB, mail mailer.Mailer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := models.User{}
+		if err := json.NewDecoder(r.Body).Decode(&user); err != nil {
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+
+		if errorMessages := user.Validate("forgotpassword"); len(errorMessages) > 0 {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			json.NewEncoder(w).Encode(errorMessages)
+			return
+		}
+
+		token, err := models.CreateResetToken(db, user.Email)
+		if err == nil {
+			resetLink := fmt.Sprintf("%s://%s/reset-password?token=%s", requestScheme(r), r.Host, token)
+			mail.Send(user.Email, "Reset your password", "Use this link to reset your password: "+resetLink)
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// requestScheme returns "https" if the request arrived over TLS or was
+// forwarded by a TLS-terminating proxy, and "http" otherwise, so links built
+// from r.Host are clickable instead of scheme-relative.
+func requestScheme(r *http.Request) string {
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		return "https"
+	}
+	return "http"
+}
+
+// ResetPassword consumes a reset token and sets the account's new password.
+func ResetPassword(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		payload := struct {
+			Token       string `json:"token"`
+			NewPassword string `json:"new_password"`
+		}{}
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+
+		if len(payload.NewPassword) < 6 {
+			http.Error(w, "password should be atleast 6 characters", http.StatusUnprocessableEntity)
+			return
+		}
+
+		if err := models.ConsumeResetToken(db, payload.Token, payload.NewPassword); err != nil {
+			// Deliberately generic: distinguishing "used" / "expired" /
+			// "not found" here would let an attacker probe token state.
+			http.Error(w, "invalid or expired token", http.StatusBadRequest)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
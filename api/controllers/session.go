@@ -0,0 +1,72 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/jinzhu/gorm"
+	"github.com/yimikao/forum/api/models"
+)
+
+// Login authenticates email/password and starts a new session, returning an
+// access JWT and a refresh token. It's wrapped in IPRateLimit so guessing
+// across many accounts from one IP is slowed even before any single
+// account's own lockout trips.
+func Login(db *gorm.DB) http.HandlerFunc {
+	return IPRateLimit(func(w http.ResponseWriter, r *http.Request) {
+		user := models.User{}
+		if err := json.NewDecoder(r.Body).Decode(&user); err != nil {
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+
+		if errorMessages := user.Validate("login"); len(errorMessages) > 0 {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			json.NewEncoder(w).Encode(errorMessages)
+			return
+		}
+
+		authenticated, err := models.AuthenticateUser(db, user.Email, user.Password)
+		if errors.Is(err, models.ErrAccountLocked) {
+			http.Error(w, err.Error(), http.StatusLocked)
+			return
+		}
+		if err != nil {
+			http.Error(w, "invalid email or password", http.StatusUnauthorized)
+			return
+		}
+
+		accessJWT, refreshToken, err := authenticated.CreateSession(db, r.UserAgent(), r.RemoteAddr)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(map[string]string{
+			"access_token":  accessJWT,
+			"refresh_token": refreshToken,
+		})
+	})
+}
+
+// RefreshToken exchanges a refresh token for a new access JWT.
+func RefreshToken(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		payload := struct {
+			RefreshToken string `json:"refresh_token"`
+		}{}
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+
+		accessJWT, err := models.RefreshSession(db, payload.RefreshToken)
+		if err != nil {
+			http.Error(w, "invalid or expired session", http.StatusUnauthorized)
+			return
+		}
+
+		json.NewEncoder(w).Encode(map[string]string{"access_token": accessJWT})
+	}
+}
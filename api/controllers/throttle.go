@@ -0,0 +1,57 @@
+package controllers
+
+import (
+	"net"
+	"net/http"
+	"sync"
+
+	"golang.org/x/time/rate"
+)
+
+// loginRateLimiters holds one rate.Limiter per remote IP, so guessing
+// passwords across many different usernames from the same IP is throttled
+// even though each individual account's own lockout (see
+// models.RegisterFailedAttempt) hasn't tripped yet.
+var (
+	loginRateLimiters   = map[string]*rate.Limiter{}
+	loginRateLimitersMu sync.Mutex
+)
+
+// loginRateLimit and loginRateBurst bound sustained and bursty login
+// attempts per IP. A new limiter is created lazily per IP and kept for the
+// life of the process; this is deliberately simple rather than LRU-evicted,
+// matching the scale this app runs at.
+const (
+	loginRateLimit = rate.Limit(1) // average: 1 attempt/sec
+	loginRateBurst = 5
+)
+
+func limiterForIP(ip string) *rate.Limiter {
+	loginRateLimitersMu.Lock()
+	defer loginRateLimitersMu.Unlock()
+
+	limiter, ok := loginRateLimiters[ip]
+	if !ok {
+		limiter = rate.NewLimiter(loginRateLimit, loginRateBurst)
+		loginRateLimiters[ip] = limiter
+	}
+	return limiter
+}
+
+// IPRateLimit wraps a handler, rejecting requests from an IP that's
+// exceeded its login attempt budget with 429.
+func IPRateLimit(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ip, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			ip = r.RemoteAddr
+		}
+
+		if !limiterForIP(ip).Allow() {
+			http.Error(w, "too many login attempts, try again later", http.StatusTooManyRequests)
+			return
+		}
+
+		next(w, r)
+	}
+}
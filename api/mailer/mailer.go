@@ -0,0 +1,41 @@
+package mailer
+
+import (
+	"fmt"
+	"net/smtp"
+	"os"
+)
+
+// Mailer dispatches plaintext email messages.
+type Mailer interface {
+	Send(to, subject, body string) error
+}
+
+// SMTPMailer sends mail through an SMTP relay configured via env vars:
+// SMTP_HOST, SMTP_PORT, SMTP_USER, SMTP_PASS, EMAIL_FROM.
+type SMTPMailer struct {
+	Host string
+	Port string
+	User string
+	Pass string
+	From string
+}
+
+// NewSMTPMailerFromEnv builds an SMTPMailer from the standard SMTP_* env vars.
+func NewSMTPMailerFromEnv() *SMTPMailer {
+	return &SMTPMailer{
+		Host: os.Getenv("SMTP_HOST"),
+		Port: os.Getenv("SMTP_PORT"),
+		User: os.Getenv("SMTP_USER"),
+		Pass: os.Getenv("SMTP_PASS"),
+		From: os.Getenv("EMAIL_FROM"),
+	}
+}
+
+func (m *SMTPMailer) Send(to, subject, body string) error {
+	addr := fmt.Sprintf("%s:%s", m.Host, m.Port)
+	auth := smtp.PlainAuth("", m.User, m.Pass, m.Host)
+
+	msg := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\n\r\n%s\r\n", m.From, to, subject, body)
+	return smtp.SendMail(addr, auth, m.From, []string{to}, []byte(msg))
+}
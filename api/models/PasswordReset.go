@@ -0,0 +1,105 @@
+package models
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// resetTokenLifetime is how long a password reset token remains valid.
+const resetTokenLifetime = time.Hour
+
+// PasswordReset tracks a single "forgot password" request for a user. Only
+// the SHA-256 hash of the token is ever persisted; the plaintext token is
+// returned once, to the caller responsible for emailing it.
+type PasswordReset struct {
+	ID        uint32     `gorm:"primary_key;auto_increment" json:"id"`
+	UserID    uint32     `gorm:"not null" json:"user_id"`
+	TokenHash string     `gorm:"size:64;not null;unique" json:"-"`
+	ExpiresAt time.Time  `gorm:"not null" json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+}
+
+func hashResetToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// CreateResetToken generates a random reset token for the user with the
+// given email, stores its hash, and returns the plaintext token so the
+// caller can email it. Returns an error if no user has that email.
+func CreateResetToken(db *gorm.DB, email string) (string, error) {
+	user := User{}
+	if err := db.Debug().Model(&User{}).Where("email_norm = ?", normalizeEmail(email)).Take(&user).Error; err != nil {
+		return "", err
+	}
+
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw)
+
+	reset := PasswordReset{
+		UserID:    user.ID,
+		TokenHash: hashResetToken(token),
+		ExpiresAt: time.Now().Add(resetTokenLifetime),
+	}
+	if err := db.Debug().Create(&reset).Error; err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// ConsumeResetToken looks up a password reset by token, validates that it is
+// unused and unexpired, updates the user's password, and marks the record
+// used. The lookup locks the row with SELECT ... FOR UPDATE inside the same
+// transaction as the password update and the used_at write, so two
+// concurrent requests for the same token can't both pass the unused check
+// before either marks it used.
+func ConsumeResetToken(db *gorm.DB, token string, newPassword string) error {
+	tokenHash := hashResetToken(token)
+
+	tx := db.Begin()
+	if tx.Error != nil {
+		return tx.Error
+	}
+
+	reset := PasswordReset{}
+	if err := tx.Debug().Set("gorm:query_option", "FOR UPDATE").Model(&PasswordReset{}).Where("token_hash = ?", tokenHash).Take(&reset).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	if reset.UsedAt != nil {
+		tx.Rollback()
+		return errors.New("reset token already used")
+	}
+	if time.Now().After(reset.ExpiresAt) {
+		tx.Rollback()
+		return errors.New("reset token expired")
+	}
+
+	user := User{}
+	if err := tx.Debug().Model(&User{}).Where("id = ?", reset.UserID).Take(&user).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	user.Password = newPassword
+	if err := user.UpdatePassword(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	now := time.Now()
+	if err := tx.Debug().Model(&PasswordReset{}).Where("id = ?", reset.ID).UpdateColumn("used_at", now).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit().Error
+}
@@ -0,0 +1,151 @@
+package models
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"time"
+
+	"github.com/jinzhu/gorm"
+
+	"github.com/yimikao/forum/api/auth"
+)
+
+// refreshTokenLifetime is how long a refresh token stays valid if it's never
+// used. RefreshSession extends ExpiresAt each time it's redeemed.
+const refreshTokenLifetime = 30 * 24 * time.Hour
+
+// Session is an opaque, revocable refresh token. Access tokens are stateless
+// JWTs; Session is what lets a user see their active devices and log out of
+// one (or all) of them.
+type Session struct {
+	ID         uint32     `gorm:"primary_key;auto_increment" json:"id"`
+	UserID     uint32     `gorm:"not null" json:"user_id"`
+	TokenHash  string     `gorm:"size:64;not null;unique" json:"-"`
+	UserAgent  string     `gorm:"size:255" json:"user_agent"`
+	IP         string     `gorm:"size:45" json:"ip"`
+	CreatedAt  time.Time  `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+	LastSeenAt time.Time  `gorm:"default:CURRENT_TIMESTAMP" json:"last_seen_at"`
+	ExpiresAt  time.Time  `gorm:"not null" json:"expires_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+}
+
+func hashSessionToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func newRefreshToken() (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+// CreateSession logs u in from a new device: it issues a short-lived access
+// JWT and persists a long-lived, hashed refresh token tied to this session.
+func (u *User) CreateSession(db *gorm.DB, userAgent, ip string) (accessJWT string, refreshToken string, err error) {
+	accessJWT, err = auth.GenerateAccessToken(u.ID, u.Role, u.TokenVersion)
+	if err != nil {
+		return "", "", err
+	}
+
+	refreshToken, err = newRefreshToken()
+	if err != nil {
+		return "", "", err
+	}
+
+	session := Session{
+		UserID:     u.ID,
+		TokenHash:  hashSessionToken(refreshToken),
+		UserAgent:  userAgent,
+		IP:         ip,
+		LastSeenAt: time.Now(),
+		ExpiresAt:  time.Now().Add(refreshTokenLifetime),
+	}
+	if err := db.Debug().Create(&session).Error; err != nil {
+		return "", "", err
+	}
+
+	return accessJWT, refreshToken, nil
+}
+
+// RefreshSession redeems a refresh token for a new access JWT, sliding the
+// session's expiry forward. It fails if the token is unknown, revoked, or
+// expired.
+func RefreshSession(db *gorm.DB, refreshToken string) (accessJWT string, err error) {
+	session := Session{}
+	if err := db.Debug().Model(&Session{}).Where("token_hash = ?", hashSessionToken(refreshToken)).Take(&session).Error; err != nil {
+		return "", err
+	}
+	if session.RevokedAt != nil {
+		return "", errors.New("session revoked")
+	}
+	if time.Now().After(session.ExpiresAt) {
+		return "", errors.New("session expired")
+	}
+
+	user := User{}
+	if err := db.Debug().Model(&User{}).Where("id = ?", session.UserID).Take(&user).Error; err != nil {
+		return "", err
+	}
+
+	accessJWT, err = auth.GenerateAccessToken(user.ID, user.Role, user.TokenVersion)
+	if err != nil {
+		return "", err
+	}
+
+	db = db.Debug().Model(&Session{}).Where("id = ?", session.ID).UpdateColumns(
+		map[string]interface{}{
+			"last_seen_at": time.Now(),
+			"expires_at":   time.Now().Add(refreshTokenLifetime),
+		},
+	)
+	if db.Error != nil {
+		return "", db.Error
+	}
+
+	return accessJWT, nil
+}
+
+// RevokeSession logs a single device out by marking its session revoked.
+// Only a session belonging to u is revoked; an id owned by another user
+// matches no row and is left untouched.
+func (u *User) RevokeSession(db *gorm.DB, id uint32) error {
+	now := time.Now()
+	db = db.Debug().Model(&Session{}).Where("id = ? AND user_id = ?", id, u.ID).UpdateColumn("revoked_at", now)
+	if db.Error != nil {
+		return db.Error
+	}
+	return nil
+}
+
+// RevokeAllSessions implements "sign out everywhere": it bumps TokenVersion
+// so every access JWT already issued fails middleware's version check, and
+// revokes every stored refresh token so they can't mint new ones either.
+func (u *User) RevokeAllSessions(db *gorm.DB) error {
+	now := time.Now()
+	if err := db.Debug().Model(&Session{}).Where("user_id = ? AND revoked_at IS NULL", u.ID).UpdateColumn("revoked_at", now).Error; err != nil {
+		return err
+	}
+
+	db = db.Debug().Model(&User{}).Where("id = ?", u.ID).UpdateColumn("token_version", gorm.Expr("token_version + 1"))
+	if db.Error != nil {
+		return db.Error
+	}
+	u.TokenVersion++
+	return nil
+}
+
+// ListSessions returns every session (active or not) belonging to userID,
+// most recently active first, so a user can review their logged-in devices.
+func (u *User) ListSessions(db *gorm.DB, userID uint32) (*[]Session, error) {
+	sessions := []Session{}
+	err := db.Debug().Model(&Session{}).Where("user_id = ?", userID).Order("last_seen_at desc").Find(&sessions).Error
+	if err != nil {
+		return nil, err
+	}
+	return &sessions, nil
+}
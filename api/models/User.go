@@ -1,6 +1,8 @@
 package models
 
 import (
+	"crypto/rand"
+	"encoding/base64"
 	"errors"
 	"html"
 	"log"
@@ -8,9 +10,10 @@ import (
 	"strings"
 	"time"
 
-	"github.com/badoux/checkmail"
 	"github.com/jinzhu/gorm"
-	"golang.org/x/crypto/bcrypt"
+
+	"github.com/yimikao/forum/api/auth"
+	"github.com/yimikao/forum/api/security"
 )
 
 // A user can:
@@ -20,28 +23,52 @@ import (
 // iv. Shutdown his account
 
 type User struct {
-	ID        uint32    `gorm:"primary_key;auto_increment" json:"id"`
-	Username  string    `gorm:"size:255;not null;unique" json:"username"`
-	Email     string    `gorm:"size:100;not null;unique" json:"email"`
-	Password  string    `gorm:"size:100;not null;" json:"password"`
-	Avatar    string    `gorm:"size:255;null;" json:"avatar"`
+	ID           uint32    `gorm:"primary_key;auto_increment" json:"id"`
+	Username     string    `gorm:"size:255;not null;unique" json:"username"`
+	Email        string    `gorm:"size:100;not null;unique" json:"email"`
+	EmailNorm    string    `gorm:"size:100;not null;unique" json:"-"`
+	Password     string    `gorm:"size:100;not null;" json:"password"`
+	Salt         string    `gorm:"size:24;not null;" json:"-"`
+	Avatar       string    `gorm:"size:255;null;" json:"avatar"`
+	Role         string    `gorm:"size:20;not null;default:'user'" json:"role"`
+	TokenVersion uint32    `gorm:"not null;default:0" json:"-"`
+
+	FailedLoginAttempts uint32     `gorm:"not null;default:0" json:"-"`
+	LastFailedLoginAt   *time.Time `json:"-"`
+	LockedUntil         *time.Time `json:"-"`
+
 	CreatedAt time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
 	UpdatedAt time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"updated_at"`
 }
 
-//a few things before saving new user record
-func hashPassword(password string) (string, error) {
-	bytes, err := bcrypt.GenerateFromPassword([]byte(password), 14)
-	return string(bytes), err
+// GetID and GetRole satisfy auth.Subject so a User can be passed directly to
+// auth.Policy.Can.
+func (u *User) GetID() uint32   { return u.ID }
+func (u *User) GetRole() string { return u.Role }
 
+//a few things before saving new user record
+func newSalt() (string, error) {
+	raw := make([]byte, 16)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(raw), nil
 }
+
 func (u *User) BeforeSave() error {
-	hashedPassword, err := hashPassword(u.Password)
+	if u.Salt == "" {
+		salt, err := newSalt()
+		if err != nil {
+			return err
+		}
+		u.Salt = salt
+	}
 
+	hashedPassword, err := security.Hash(u.Password, u.Salt)
 	if err != nil {
 		return err
 	}
-	u.Password = hashedPassword
+	u.Password = string(hashedPassword)
 	return nil
 }
 
@@ -49,6 +76,10 @@ func (u *User) BeforeSave() error {
 func (u *User) Prepare() {
 	u.Username = html.EscapeString(strings.TrimSpace(u.Username))
 	u.Email = html.EscapeString(strings.TrimSpace(u.Email))
+	u.EmailNorm = normalizeEmail(u.Email)
+	if u.Role == "" {
+		u.Role = auth.RoleUser
+	}
 	u.CreatedAt = time.Now()
 	u.UpdatedAt = time.Now()
 }
@@ -75,7 +106,7 @@ func (u *User) Validate(action string) map[string]string {
 			errorMessages["required_email"] = err.Error()
 		}
 		if u.Email != "" {
-			if err = checkmail.ValidateFormat(u.Email); err != nil {
+			if err = validateEmailFormat(u.Email); err != nil {
 				err = errors.New("invalid Email")
 				errorMessages["invalid_email"] = err.Error()
 			}
@@ -90,7 +121,7 @@ func (u *User) Validate(action string) map[string]string {
 			errorMessages["required_email"] = err.Error()
 		}
 		if u.Email != "" {
-			if err = checkmail.ValidateFormat(u.Email); err != nil {
+			if err = validateEmailFormat(u.Email); err != nil {
 				err = errors.New("invalid email")
 				errorMessages["invalid_email"] = err.Error()
 			}
@@ -101,7 +132,7 @@ func (u *User) Validate(action string) map[string]string {
 			errorMessages["required_password"] = err.Error()
 		}
 		if u.Email != "" {
-			if err = checkmail.ValidateFormat(u.Email); err != nil {
+			if err = validateEmailFormat(u.Email); err != nil {
 				err = errors.New("invalid email")
 				errorMessages["invalid_email"] = err.Error()
 			}
@@ -127,7 +158,7 @@ func (u *User) Validate(action string) map[string]string {
 			errorMessages["required_email"] = err.Error()
 		}
 		if u.Email != "" {
-			if err = checkmail.ValidateFormat(u.Email); err != nil {
+			if err = validateEmailFormat(u.Email); err != nil {
 				err = errors.New("invalid email")
 				errorMessages["invalid_email"] = err.Error()
 			}
@@ -165,6 +196,9 @@ func (u *User) FindUserById(db *gorm.DB, id uint32) (*User, error) {
 	return u, err
 }
 
+// UpdateUser updates a user's own profile. It never writes u.Role, even if
+// the caller set one, so a user can't promote themselves; role changes must
+// go through an admin-only endpoint guarded by auth.RequirePermission.
 func (u *User) UpdateUser(db *gorm.DB, id int32) (*User, error) {
 
 	if u.Password != "" {
@@ -176,6 +210,7 @@ func (u *User) UpdateUser(db *gorm.DB, id int32) (*User, error) {
 		db = db.Debug().Model(&User{}).Where("id = ?", id).Take(&User{}).UpdateColumns(
 			map[string]interface{}{
 				"password":   u.Password,
+				"salt":       u.Salt,
 				"email":      u.Email,
 				"updated_at": time.Now(),
 			},
@@ -228,11 +263,12 @@ func (u *User) DeleteUser(db *gorm.DB, id int32) (int64, error) {
 func (u *User) UpdatePassword(db *gorm.DB) error {
 	err := u.BeforeSave()
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
-	db = db.Debug().Model(&User{}).Where("email = ?", u.Email).Take(&User{}).UpdateColumns(
+	db = db.Debug().Model(&User{}).Where("email_norm = ?", normalizeEmail(u.Email)).Take(&User{}).UpdateColumns(
 		map[string]interface{}{
 			"password":  u.Password,
+			"salt":      u.Salt,
 			"update_at": time.Now(),
 		},
 	)
@@ -241,3 +277,52 @@ func (u *User) UpdatePassword(db *gorm.DB) error {
 	}
 	return nil
 }
+
+// AuthenticateUser verifies email/password against the stored, salted and
+// peppered hash. It refuses to even check the password while the account is
+// locked out from prior failures, returning ErrAccountLocked. Rows created
+// before per-user salting (Salt == "") are verified against the old plain
+// bcrypt scheme instead, then transparently rehashed and saved under the
+// current scheme so the legacy hash is only ever checked once. Likewise, if
+// the stored hash was produced at a bcrypt cost lower than the currently
+// configured one, it transparently rehashes and saves the password so
+// hashing strength can be ratcheted up over time without forcing a password
+// reset.
+func AuthenticateUser(db *gorm.DB, email, password string) (*User, error) {
+	user := User{}
+	if err := db.Debug().Model(&User{}).Where("email_norm = ?", normalizeEmail(email)).Take(&user).Error; err != nil {
+		return nil, err
+	}
+
+	if user.LockedUntil != nil && time.Now().Before(*user.LockedUntil) {
+		return nil, ErrAccountLocked
+	}
+
+	legacy := user.Salt == ""
+	var verifyErr error
+	if legacy {
+		verifyErr = security.VerifyLegacyPassword(user.Password, password)
+	} else {
+		verifyErr = security.VerifyPassword(user.Password, password, user.Salt)
+	}
+
+	if verifyErr != nil {
+		if regErr := user.RegisterFailedAttempt(db); regErr != nil {
+			return nil, regErr
+		}
+		return nil, errors.New("invalid email or password")
+	}
+
+	if err := user.ResetFailedAttempts(db); err != nil {
+		return nil, err
+	}
+
+	if legacy || security.NeedsRehash(user.Password) {
+		user.Password = password
+		if err := user.UpdatePassword(db); err != nil {
+			return nil, err
+		}
+	}
+
+	return &user, nil
+}
@@ -0,0 +1,57 @@
+package models
+
+import (
+	"strings"
+
+	"github.com/badoux/checkmail"
+	"golang.org/x/net/idna"
+)
+
+// gmailLikeDomains are providers known to ignore dots in the local part and
+// treat anything after a "+" as a tag, so "f.oo+news@gmail.com" and
+// "foo@gmail.com" reach the same inbox and should collide as one account.
+var gmailLikeDomains = map[string]bool{
+	"gmail.com":      true,
+	"googlemail.com": true,
+}
+
+// normalizeEmail canonicalizes an email address for uniqueness checks:
+// lowercases the domain, IDN-punycodes it, and for gmail-like providers
+// strips "+tag" suffixes and dots from the local part. The original, as
+// typed by the user, is preserved separately in User.Email for display.
+func normalizeEmail(email string) string {
+	email = strings.TrimSpace(email)
+
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return strings.ToLower(email)
+	}
+	local, domain := email[:at], email[at+1:]
+
+	domain = strings.ToLower(domain)
+	if punycode, err := idna.Lookup.ToASCII(domain); err == nil {
+		domain = punycode
+	}
+
+	if gmailLikeDomains[domain] {
+		if plus := strings.Index(local, "+"); plus >= 0 {
+			local = local[:plus]
+		}
+		local = strings.ReplaceAll(local, ".", "")
+	}
+	local = strings.ToLower(local)
+
+	return local + "@" + domain
+}
+
+// validateEmailFormat checks that email, and the normalized form SaveUser
+// will actually store in EmailNorm, both parse as a valid address.
+// Normalizing can turn a syntactically valid email into an empty local part
+// (e.g. "+@gmail.com" strips to "@gmail.com"), so checking only the original
+// form isn't enough.
+func validateEmailFormat(email string) error {
+	if err := checkmail.ValidateFormat(email); err != nil {
+		return err
+	}
+	return checkmail.ValidateFormat(normalizeEmail(email))
+}
@@ -0,0 +1,81 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// maxFailedLoginAttempts is how many failures within failedLoginWindow lock
+// an account; the failure that reaches this count triggers the lock.
+const maxFailedLoginAttempts = 5
+
+// failedLoginWindow bounds how long failures are allowed to accumulate
+// toward maxFailedLoginAttempts. A failure older than this resets the
+// counter instead of adding to it, so lockout tracks rapid-fire guessing
+// rather than occasional mistyped passwords over the account's lifetime.
+const failedLoginWindow = 15 * time.Minute
+
+// lockoutBackoff is the lockout duration for each failure from
+// maxFailedLoginAttempts on, indexed by (attempts - maxFailedLoginAttempts).
+// The last entry repeats for any further failures.
+var lockoutBackoff = []time.Duration{
+	time.Minute,
+	5 * time.Minute,
+	30 * time.Minute,
+	time.Hour,
+}
+
+// ErrAccountLocked is returned by AuthenticateUser while LockedUntil is in
+// the future, distinct from a plain bad-credentials error so callers can
+// show a different message.
+var ErrAccountLocked = errors.New("account locked due to too many failed login attempts")
+
+func backoffFor(attempts uint32) time.Duration {
+	index := int(attempts) - maxFailedLoginAttempts
+	if index < 0 {
+		index = 0
+	}
+	if index >= len(lockoutBackoff) {
+		index = len(lockoutBackoff) - 1
+	}
+	return lockoutBackoff[index]
+}
+
+// RegisterFailedAttempt records a failed login for u, locking the account
+// with exponential backoff once maxFailedLoginAttempts is reached.
+func (u *User) RegisterFailedAttempt(db *gorm.DB) error {
+	now := time.Now()
+	if u.LastFailedLoginAt != nil && now.Sub(*u.LastFailedLoginAt) > failedLoginWindow {
+		u.FailedLoginAttempts = 0
+	}
+	u.FailedLoginAttempts++
+	u.LastFailedLoginAt = &now
+
+	columns := map[string]interface{}{
+		"failed_login_attempts": u.FailedLoginAttempts,
+		"last_failed_login_at":  now,
+	}
+
+	if u.FailedLoginAttempts >= maxFailedLoginAttempts {
+		lockedUntil := now.Add(backoffFor(u.FailedLoginAttempts))
+		u.LockedUntil = &lockedUntil
+		columns["locked_until"] = lockedUntil
+	}
+
+	return db.Debug().Model(&User{}).Where("id = ?", u.ID).UpdateColumns(columns).Error
+}
+
+// ResetFailedAttempts clears the failure counter and any lock after a
+// successful login.
+func (u *User) ResetFailedAttempts(db *gorm.DB) error {
+	u.FailedLoginAttempts = 0
+	u.LastFailedLoginAt = nil
+	u.LockedUntil = nil
+
+	return db.Debug().Model(&User{}).Where("id = ?", u.ID).UpdateColumns(map[string]interface{}{
+		"failed_login_attempts": 0,
+		"locked_until":          nil,
+	}).Error
+}
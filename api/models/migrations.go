@@ -0,0 +1,40 @@
+package models
+
+import "github.com/jinzhu/gorm"
+
+// Deployment order for the EmailNorm column matters: add it WITHOUT the
+// unique constraint, run BackfillEmailNorm to completion, confirm
+// PendingEmailNormBackfill returns 0, and only then apply the unique index.
+// Enforcing uniqueness before the backfill finishes means every existing row
+// still has EmailNorm == "" and collides with every other one on the first
+// row, breaking the migration.
+
+// BackfillEmailNorm computes EmailNorm for any existing row where it's
+// empty. Run this once after deploying the EmailNorm column, before the
+// unique index is enforced, so pre-existing users get a normalized email
+// without needing to log in first.
+func BackfillEmailNorm(db *gorm.DB) error {
+	users := []User{}
+	if err := db.Debug().Model(&User{}).Where("email_norm = ?", "").Find(&users).Error; err != nil {
+		return err
+	}
+
+	for _, user := range users {
+		norm := normalizeEmail(user.Email)
+		if err := db.Debug().Model(&User{}).Where("id = ?", user.ID).UpdateColumn("email_norm", norm).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PendingEmailNormBackfill reports how many rows still have an empty
+// EmailNorm. The migration that adds the EmailNorm unique index must not run
+// until this returns 0, or it will fail (or, on a database that allows
+// multiple NULLs but not multiple empty strings, silently under-enforce
+// uniqueness) on the unbackfilled rows.
+func PendingEmailNormBackfill(db *gorm.DB) (int, error) {
+	var count int
+	err := db.Debug().Model(&User{}).Where("email_norm = ?", "").Count(&count).Error
+	return count, err
+}
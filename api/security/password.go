@@ -2,15 +2,84 @@ package security
 
 //Password Security: before a password is saved in our database
 
-import "golang.org/x/crypto/bcrypt"
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"os"
+	"strconv"
 
-func Hash(password string) ([]byte, error) {
+	"golang.org/x/crypto/bcrypt"
+)
 
-	return bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+// DefaultBcryptCost is used when AUTH_BCRYPT_COST isn't set or isn't a
+// valid bcrypt cost. This is intentionally lower than the cost 14 used by
+// the pre-salt/pepper hashPassword it replaces: the salt and pepper already
+// add work an attacker can't skip (no shared rainbow table across users, and
+// the pepper isn't in the stolen DB at all), so 12 keeps login latency
+// reasonable for the same effective strength. Deployments that want the old
+// margin back can set AUTH_BCRYPT_COST=14.
+const DefaultBcryptCost = 12
+
+// BcryptCost returns the configured bcrypt cost from AUTH_BCRYPT_COST,
+// falling back to DefaultBcryptCost. Deployments can raise this over time to
+// ratchet up hashing strength; NeedsRehash detects passwords hashed at an
+// older, lower cost.
+func BcryptCost() int {
+	cost, err := strconv.Atoi(os.Getenv("AUTH_BCRYPT_COST"))
+	if err != nil || cost < bcrypt.MinCost || cost > bcrypt.MaxCost {
+		return DefaultBcryptCost
+	}
+	return cost
 }
 
-func VerifyPassword(hashedPassword, password string) error {
+// Pepper returns the application-wide secret mixed into every password
+// before hashing, loaded from AUTH_PEPPER. Unlike the per-user salt, it's
+// never stored in the database, so a stolen DB alone can't be used to brute
+// force passwords offline.
+func Pepper() string {
+	return os.Getenv("AUTH_PEPPER")
+}
 
+// preHash combines password with salt and the app-wide pepper into a fixed
+// 32-byte digest via HMAC-SHA256 (keyed on the pepper) before it ever reaches
+// bcrypt. Bcrypt silently truncates its input at 72 bytes, and salt+pepper
+// alone can already eat most of that budget; pre-hashing to a fixed length
+// guarantees no password bytes are ever dropped.
+func preHash(password, salt string) []byte {
+	mac := hmac.New(sha256.New, []byte(Pepper()))
+	mac.Write([]byte(salt))
+	mac.Write([]byte(password))
+	return mac.Sum(nil)
+}
+
+// Hash combines password with salt and the app-wide pepper, then bcrypts the
+// result at the configured cost.
+func Hash(password, salt string) ([]byte, error) {
+	return bcrypt.GenerateFromPassword(preHash(password, salt), BcryptCost())
+}
+
+// VerifyPassword checks password (combined with salt and the app-wide
+// pepper) against hashedPassword.
+func VerifyPassword(hashedPassword, password, salt string) error {
+	return bcrypt.CompareHashAndPassword([]byte(hashedPassword), preHash(password, salt))
+}
+
+// VerifyLegacyPassword checks password against hashedPassword using the
+// scheme in place before per-user salting was introduced: a plain bcrypt of
+// the raw password, with no salt and no pepper mixed in. Callers use this
+// for rows with an empty Salt, then rehash under the current scheme on
+// success so the legacy hash is never checked twice.
+func VerifyLegacyPassword(hashedPassword, password string) error {
 	return bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password))
+}
 
+// NeedsRehash reports whether hashedPassword was bcrypted at a cost lower
+// than the currently configured cost, meaning it should be rehashed next
+// time the plaintext password is available (i.e. on successful login).
+func NeedsRehash(hashedPassword string) bool {
+	cost, err := bcrypt.Cost([]byte(hashedPassword))
+	if err != nil {
+		return true
+	}
+	return cost < BcryptCost()
 }